@@ -1,24 +1,65 @@
 package zplgfa
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"image"
 	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
 	"math"
 	"strings"
+	"sync"
 
-	"github.com/nfnt/resize"
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
 )
 
 // GraphicType is a type to select the graphic format
 type GraphicType int
 
+// Filter selects the resampling filter used when an image is resized.
+type Filter int
+
+// DitherMode selects how a grayscale image is reduced to the 1-bit-per-pixel format
+// the ZPL Graphic Field needs.
+type DitherMode int
+
+// Dither configures how ConvertToGraphicField quantizes grayscale pixels down to
+// black/white. Threshold is only consulted by the Threshold mode and defaults to 0.5.
+type Dither struct {
+	Mode      DitherMode `json:"mode"`
+	Threshold float64    `json:"threshold"`
+}
+
+// Sharpen configures an unsharp-mask sharpening pass: the image is blurred with the
+// given Radius, and Amount times the difference between the original and the blurred
+// version is added back in. Amount 0 (the default) disables sharpening.
+type Sharpen struct {
+	Radius float64 `json:"radius"`
+	Amount float64 `json:"amount"`
+}
+
 type Config struct {
-	MaxWidth    int          `json:"max_width"`
-	MaxHeight   int          `json:"max_height"`
-	Scale       float64      `json:"scale"`
-	Darkness    float64      `json:"darkness"`
+	MaxWidth       int                  `json:"max_width"`
+	MaxHeight      int                  `json:"max_height"`
+	Scale          float64              `json:"scale"`
+	Darkness       float64              `json:"darkness"`
+	Filter         Filter               `json:"filter"`
+	Dither         Dither               `json:"dither"`
+	PNGCompression png.CompressionLevel `json:"png_compression"`
+	// Brightness is an additive offset in [-1,1], 0 leaves the image unchanged.
+	Brightness float64 `json:"brightness"`
+	// Contrast scales how far each channel sits from mid-gray, 0 leaves the image
+	// unchanged, negative values flatten it and positive values punch it up.
+	Contrast float64 `json:"contrast"`
+	// Gamma sets a power-law tone curve that raises each channel to 1/Gamma, so values
+	// above 1 brighten midtones; 1 (and the zero value) leaves the image unchanged.
+	Gamma       float64      `json:"gamma"`
+	Sharpen     Sharpen      `json:"sharpen"`
 	ImageConfig image.Config `json:"-"`
 }
 
@@ -29,8 +70,191 @@ const (
 	Binary
 	// CompressedASCII compresses the hex data via RLE
 	CompressedASCII
+	// PNG downloads the graphic as a PNG via ~DY and recalls it via ^IM. It is not a
+	// ^GF encoding, see ConvertToStoredGraphic.
+	PNG
+	// PNGStored skips the ~DY download and only emits the ^IM recall command, for
+	// graphics a previous PNG call already stored on the printer.
+	PNGStored
+)
+
+const (
+	// Lanczos is a high quality resampling filter, the default
+	Lanczos Filter = iota
+	// CatmullRom is a sharp bicubic resampling filter
+	CatmullRom
+	// Linear is a bilinear resampling filter
+	Linear
+	// NearestNeighbor is the fastest, lowest quality resampling filter
+	NearestNeighbor
 )
 
+const (
+	// DitherNone thresholds every pixel at 50% luminance, the original behavior
+	DitherNone DitherMode = iota
+	// DitherFloydSteinberg diffuses each pixel's quantization error to its neighbors
+	DitherFloydSteinberg
+	// DitherAtkinson is a lighter-touch error diffusion used by classic Mac paint tools
+	DitherAtkinson
+	// DitherBayer4x4 is an ordered dither using a 4x4 threshold matrix
+	DitherBayer4x4
+	// DitherBayer8x8 is an ordered dither using a 8x8 threshold matrix
+	DitherBayer8x8
+	// DitherThreshold thresholds every pixel against Dither.Threshold
+	DitherThreshold
+)
+
+// bayer4x4 is the normalized (0..1) 4x4 Bayer ordered-dithering threshold matrix.
+var bayer4x4 = [4][4]float64{
+	{0.0 / 16, 8.0 / 16, 2.0 / 16, 10.0 / 16},
+	{12.0 / 16, 4.0 / 16, 14.0 / 16, 6.0 / 16},
+	{3.0 / 16, 11.0 / 16, 1.0 / 16, 9.0 / 16},
+	{15.0 / 16, 7.0 / 16, 13.0 / 16, 5.0 / 16},
+}
+
+// bayer8x8 is the normalized (0..1) 8x8 Bayer ordered-dithering threshold matrix.
+var bayer8x8 = [8][8]float64{
+	{0.0 / 64, 48.0 / 64, 12.0 / 64, 60.0 / 64, 3.0 / 64, 51.0 / 64, 15.0 / 64, 63.0 / 64},
+	{32.0 / 64, 16.0 / 64, 44.0 / 64, 28.0 / 64, 35.0 / 64, 19.0 / 64, 47.0 / 64, 31.0 / 64},
+	{8.0 / 64, 56.0 / 64, 4.0 / 64, 52.0 / 64, 11.0 / 64, 59.0 / 64, 7.0 / 64, 55.0 / 64},
+	{40.0 / 64, 24.0 / 64, 36.0 / 64, 20.0 / 64, 43.0 / 64, 27.0 / 64, 39.0 / 64, 23.0 / 64},
+	{2.0 / 64, 50.0 / 64, 14.0 / 64, 62.0 / 64, 1.0 / 64, 49.0 / 64, 13.0 / 64, 61.0 / 64},
+	{34.0 / 64, 18.0 / 64, 46.0 / 64, 30.0 / 64, 33.0 / 64, 17.0 / 64, 45.0 / 64, 29.0 / 64},
+	{10.0 / 64, 58.0 / 64, 6.0 / 64, 54.0 / 64, 9.0 / 64, 57.0 / 64, 5.0 / 64, 53.0 / 64},
+	{42.0 / 64, 26.0 / 64, 38.0 / 64, 22.0 / 64, 41.0 / 64, 25.0 / 64, 37.0 / 64, 21.0 / 64},
+}
+
+func (d Dither) threshold() float64 {
+	if d.Threshold == 0.0 {
+		return 0.5
+	}
+	return d.Threshold
+}
+
+// buildGrayscaleBuffer converts img to a single row-major grayscale buffer (buf[y*width+x]),
+// normalized to 0..1, that the dithering algorithms below run against. buf is reused if it
+// has enough capacity, so callers converting many images can avoid re-allocating it; pass
+// nil to always allocate fresh.
+func buildGrayscaleBuffer(img image.Image, buf []float64) []float64 {
+	size := img.Bounds().Size()
+	n := size.X * size.Y
+	if cap(buf) < n {
+		buf = make([]float64, n)
+	}
+	buf = buf[:n]
+	for y := 0; y < size.Y; y++ {
+		row := y * size.X
+		for x := 0; x < size.X; x++ {
+			lum := color.Gray16Model.Convert(img.At(x, y)).(color.Gray16)
+			buf[row+x] = float64(lum.Y) / float64(math.MaxUint16)
+		}
+	}
+	return buf
+}
+
+// diffuseError spreads err onto buf[y*width+x] if that pixel is within bounds.
+func diffuseError(buf []float64, width, height, x, y int, err, weight float64) {
+	if y < 0 || y >= height || x < 0 || x >= width {
+		return
+	}
+	buf[y*width+x] += err * weight
+}
+
+// ditherImage reduces the width x height grayscale buffer buf (row-major, buf[y*width+x])
+// to a black/white bit matrix (true == black, same layout) using the given Dither
+// configuration. buf is consumed destructively by the error-diffusion modes. bits is
+// reused if it has enough capacity, so callers converting many images can avoid
+// re-allocating it; pass nil to always allocate fresh.
+func ditherImage(buf []float64, width, height int, dither Dither, bits []bool) []bool {
+	n := width * height
+	if cap(bits) < n {
+		bits = make([]bool, n)
+	}
+	bits = bits[:n]
+
+	switch dither.Mode {
+	case DitherFloydSteinberg:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				old := buf[y*width+x]
+				black := old < 0.5
+				bits[y*width+x] = black
+				var err float64
+				if black {
+					err = old - 0.0
+				} else {
+					err = old - 1.0
+				}
+				diffuseError(buf, width, height, x+1, y, err, 7.0/16)
+				diffuseError(buf, width, height, x-1, y+1, err, 3.0/16)
+				diffuseError(buf, width, height, x, y+1, err, 5.0/16)
+				diffuseError(buf, width, height, x+1, y+1, err, 1.0/16)
+			}
+		}
+	case DitherAtkinson:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				old := buf[y*width+x]
+				black := old < 0.5
+				bits[y*width+x] = black
+				var err float64
+				if black {
+					err = old - 0.0
+				} else {
+					err = old - 1.0
+				}
+				diffuseError(buf, width, height, x+1, y, err, 1.0/8)
+				diffuseError(buf, width, height, x+2, y, err, 1.0/8)
+				diffuseError(buf, width, height, x-1, y+1, err, 1.0/8)
+				diffuseError(buf, width, height, x, y+1, err, 1.0/8)
+				diffuseError(buf, width, height, x+1, y+1, err, 1.0/8)
+				diffuseError(buf, width, height, x, y+2, err, 1.0/8)
+			}
+		}
+	case DitherBayer4x4:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				bits[y*width+x] = buf[y*width+x] < bayer4x4[y%4][x%4]
+			}
+		}
+	case DitherBayer8x8:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				bits[y*width+x] = buf[y*width+x] < bayer8x8[y%8][x%8]
+			}
+		}
+	case DitherThreshold:
+		cutoff := dither.threshold()
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				bits[y*width+x] = buf[y*width+x] < cutoff
+			}
+		}
+	default:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				bits[y*width+x] = buf[y*width+x] < 0.5
+			}
+		}
+	}
+
+	return bits
+}
+
+// imagingFilter maps a Filter to the equivalent imaging.ResampleFilter
+func (f Filter) imagingFilter() imaging.ResampleFilter {
+	switch f {
+	case CatmullRom:
+		return imaging.CatmullRom
+	case Linear:
+		return imaging.Linear
+	case NearestNeighbor:
+		return imaging.NearestNeighbor
+	default:
+		return imaging.Lanczos
+	}
+}
+
 func (c *Config) setDefaultConfig() {
 	c.Scale = math.Max(0.0, c.Scale)
 	c.Darkness = math.Max(0.0, math.Min(1.0, c.Darkness))
@@ -45,8 +269,78 @@ func (c *Config) setDefaultConfig() {
 
 // ConvertToZPL is just a wrapper for ConvertToGraphicField which also includes the ZPL
 // starting code ^XA and ending code ^XZ, as well as a Field Separator and Field Origin.
-func ConvertToZPL(img image.Image, graphicType GraphicType) string {
-	return fmt.Sprintf("^XA,^FS\n^FO0,0\n%s^FS,^XZ\n", ConvertToGraphicField(img, graphicType))
+func ConvertToZPL(img image.Image, graphicType GraphicType, dither Dither) (string, error) {
+	gf, err := ConvertToGraphicField(img, graphicType, dither)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("^XA,^FS\n^FO0,0\n%s^FS,^XZ\n", gf), nil
+}
+
+// FlattenReader reads an image from r, corrects its orientation according to the EXIF
+// Orientation tag (if present) and runs it through FlattenImage. This is the preferred
+// entry point for photos coming straight off a camera or phone, since those are commonly
+// stored in a sensor-native orientation and rely on the tag to be displayed upright.
+func FlattenReader(r io.Reader, config Config) (*image.NRGBA, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	source = applyOrientation(source, readOrientation(bytes.NewReader(raw)))
+
+	bounds := source.Bounds().Size()
+	config.ImageConfig = image.Config{Width: bounds.X, Height: bounds.Y}
+
+	return FlattenImage(source, config), nil
+}
+
+// readOrientation extracts the EXIF Orientation tag from r, returning 1 (the identity
+// orientation) if the data has no EXIF segment or no Orientation tag at all.
+func readOrientation(r io.Reader) int {
+	x, err := exif.Decode(r)
+	if err != nil {
+		return 1
+	}
+
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+
+	orientation, err := tag.Int(0)
+	if err != nil {
+		return 1
+	}
+
+	return orientation
+}
+
+// applyOrientation rotates/flips img according to the EXIF orientation values 1..8.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	default:
+		return img
+	}
 }
 
 // FlattenImage optimizes an image for the converting process
@@ -72,7 +366,7 @@ func FlattenImage(source image.Image, config Config) *image.NRGBA {
 			targetHeight = 0
 		}
 
-		source = resize.Resize(targetWidth, targetHeight, source, resize.Lanczos3)
+		source = imaging.Resize(source, int(targetWidth), int(targetHeight), config.Filter.imagingFilter())
 	}
 
 	size := source.Bounds().Size()
@@ -85,7 +379,7 @@ func FlattenImage(source image.Image, config Config) *image.NRGBA {
 			target.Set(x, y, flat)
 		}
 	}
-	return target
+	return adjustImage(target, config)
 }
 
 func flatten(input color.Color, background color.Color, darkness float64) color.Color {
@@ -107,6 +401,86 @@ func flatten(input color.Color, background color.Color, darkness float64) color.
 	return c
 }
 
+func clamp255(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
+
+// gammaLUT precomputes a 256-entry power-law lookup table for the given gamma.
+func gammaLUT(gamma float64) [256]uint8 {
+	var lut [256]uint8
+	for i := 0; i < 256; i++ {
+		lut[i] = uint8(clamp255(math.Pow(float64(i)/255, 1/gamma) * 255))
+	}
+	return lut
+}
+
+// adjustImage applies brightness, contrast, gamma and unsharp-mask sharpening directly
+// against img's NRGBA pixel buffer, in that order, skipping any step whose Config field
+// is at its zero value so FlattenImage's behavior is unchanged when they're unused.
+func adjustImage(img *image.NRGBA, config Config) *image.NRGBA {
+	hasBrightness := config.Brightness != 0
+	hasContrast := config.Contrast != 0
+	hasGamma := config.Gamma != 0 && config.Gamma != 1.0
+
+	if hasBrightness || hasContrast || hasGamma {
+		brightnessOffset := config.Brightness * 255
+		var lut [256]uint8
+		if hasGamma {
+			lut = gammaLUT(config.Gamma)
+		}
+
+		size := img.Bounds().Size()
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				offset := img.PixOffset(x, y)
+				for c := 0; c < 3; c++ {
+					v := float64(img.Pix[offset+c])
+					if hasBrightness {
+						v += brightnessOffset
+					}
+					if hasContrast {
+						v = ((v/255)-0.5)*(1+config.Contrast)*255 + 127.5
+					}
+					v = clamp255(v)
+					if hasGamma {
+						img.Pix[offset+c] = lut[uint8(v)]
+					} else {
+						img.Pix[offset+c] = uint8(v)
+					}
+				}
+			}
+		}
+	}
+
+	if config.Sharpen.Amount != 0 && config.Sharpen.Radius > 0 {
+		img = unsharpMask(img, config.Sharpen.Radius, config.Sharpen.Amount)
+	}
+
+	return img
+}
+
+// unsharpMask sharpens img by adding amount times the difference between img and a
+// Gaussian-blurred copy of itself back onto every color channel.
+func unsharpMask(img *image.NRGBA, radius, amount float64) *image.NRGBA {
+	blurred := imaging.Blur(img, radius)
+	out := image.NewNRGBA(img.Bounds())
+	for i := range img.Pix {
+		if i%4 == 3 {
+			out.Pix[i] = img.Pix[i]
+			continue
+		}
+		orig := float64(img.Pix[i])
+		out.Pix[i] = uint8(clamp255(orig + amount*(orig-float64(blurred.Pix[i]))))
+	}
+	return out
+}
+
 func getRepeatCode(repeatCount int, char string) string {
 	repeatStr := ""
 	if repeatCount > 419 {
@@ -179,11 +553,68 @@ func CompressASCII(in string) string {
 	return output
 }
 
-// ConvertToGraphicField converts an image.Image picture to a ZPL compatible Graphic Field.
-// The ZPL ^GF (Graphic Field) supports various data formats, this package supports the
-// normal ASCII encoded, as well as a RLE compressed ASCII format. It also supports the
-// Binary Graphic Field format. The encoding can be chosen by the second argument.
-func ConvertToGraphicField(source image.Image, graphicType GraphicType) string {
+// EncoderBuffer holds the scratch space an Encoder needs to turn one image into a
+// Graphic Field: a packed-bits row buffer, a hex-encoding scratch buffer, the grayscale
+// and dithered-bits buffers for the whole image, and the accumulated Graphic Field body.
+// The grayscale/bits buffers dominate total allocation for large labels, so pooling them
+// here (not just the small per-row scratch) is what makes converting many labels in a
+// row avoid repeatedly allocating multi-megabyte buffers.
+type EncoderBuffer struct {
+	row  []byte
+	hex  []byte
+	gray []float64
+	bits []bool
+	data bytes.Buffer
+}
+
+// BufferPool is implemented by types that can retain EncoderBuffers between calls to
+// Encoder.Encode, mirroring image/png's EncoderBufferPool. Callers converting many
+// labels can supply their own pool (e.g. sized to a known worker count) instead of
+// relying on Encoder's package-level sync.Pool default.
+type BufferPool interface {
+	Get() *EncoderBuffer
+	Put(*EncoderBuffer)
+}
+
+type defaultBufferPool struct{}
+
+var encoderBuffers = sync.Pool{New: func() interface{} { return new(EncoderBuffer) }}
+
+func (defaultBufferPool) Get() *EncoderBuffer {
+	return encoderBuffers.Get().(*EncoderBuffer)
+}
+
+func (defaultBufferPool) Put(b *EncoderBuffer) {
+	b.data.Reset()
+	encoderBuffers.Put(b)
+}
+
+// Encoder converts an image.Image into a ZPL Graphic Field, writing straight to an
+// io.Writer instead of building the result via repeated string concatenation, and
+// reusing row/hex scratch buffers across calls through BufferPool.
+type Encoder struct {
+	GraphicType GraphicType
+	Dither      Dither
+	// BufferPool optionally specifies a buffer pool to use to reuse EncoderBuffers
+	// across multiple Encode calls. If nil, a default package-level pool is used.
+	BufferPool BufferPool
+}
+
+// Encode writes the ZPL Graphic Field for source to w.
+func (enc *Encoder) Encode(w io.Writer, source image.Image) error {
+	switch enc.GraphicType {
+	case ASCII, Binary, CompressedASCII:
+	default:
+		return fmt.Errorf("zplgfa: Encoder: graphic type %v is not a ^GF encoding, use ConvertToStoredGraphic instead", enc.GraphicType)
+	}
+
+	pool := enc.BufferPool
+	if pool == nil {
+		pool = defaultBufferPool{}
+	}
+	eb := pool.Get()
+	defer pool.Put(eb)
+
 	var gfType string
 	var lastLine string
 	size := source.Bounds().Size()
@@ -193,18 +624,29 @@ func ConvertToGraphicField(source image.Image, graphicType GraphicType) string {
 		width = width + 1
 	}
 
-	var GraphicFieldData string
+	if cap(eb.row) < width {
+		eb.row = make([]byte, width)
+	}
+	line := eb.row[:width]
+	if cap(eb.hex) < hex.EncodedLen(width) {
+		eb.hex = make([]byte, hex.EncodedLen(width))
+	}
+	hexBuf := eb.hex[:hex.EncodedLen(width)]
+
+	eb.gray = buildGrayscaleBuffer(source, eb.gray)
+	eb.bits = ditherImage(eb.gray, size.X, size.Y, enc.Dither, eb.bits)
+	bits := eb.bits
 
 	for y := 0; y < size.Y; y++ {
-		line := make([]uint8, width)
+		for i := range line {
+			line[i] = 0
+		}
 		lineIndex := 0
 		index := uint8(0)
 		currentByte := line[lineIndex]
 		for x := 0; x < size.X; x++ {
 			index = index + 1
-			p := source.At(x, y)
-			lum := color.Gray16Model.Convert(p).(color.Gray16)
-			if lum.Y < math.MaxUint16/2 {
+			if bits[y*size.X+x] {
 				currentByte = currentByte | (1 << (8 - index))
 			}
 			if index >= 8 {
@@ -217,29 +659,105 @@ func ConvertToGraphicField(source image.Image, graphicType GraphicType) string {
 			}
 		}
 
-		hexstr := strings.ToUpper(hex.EncodeToString(line))
+		hex.Encode(hexBuf, line)
+		hexstr := strings.ToUpper(string(hexBuf))
 
-		switch graphicType {
+		switch enc.GraphicType {
 		case ASCII:
-			GraphicFieldData += fmt.Sprintln(hexstr)
+			eb.data.WriteString(hexstr)
+			eb.data.WriteByte('\n')
 		case CompressedASCII:
 			curLine := CompressASCII(hexstr)
 			if lastLine == curLine {
-				GraphicFieldData += ":"
+				eb.data.WriteByte(':')
 			} else {
-				GraphicFieldData += curLine
+				eb.data.WriteString(curLine)
 			}
 			lastLine = curLine
 		case Binary:
-			GraphicFieldData += fmt.Sprintf("%s", line)
+			eb.data.Write(line)
 		}
 	}
 
-	if graphicType == ASCII || graphicType == CompressedASCII {
+	if enc.GraphicType == ASCII || enc.GraphicType == CompressedASCII {
 		gfType = "A"
-	} else if graphicType == Binary {
+	} else if enc.GraphicType == Binary {
 		gfType = "B"
 	}
 
-	return fmt.Sprintf("^GF%s,%d,%d,%d,\n%s", gfType, len(GraphicFieldData), width*height, width, GraphicFieldData)
+	if _, err := fmt.Fprintf(w, "^GF%s,%d,%d,%d,\n", gfType, eb.data.Len(), width*height, width); err != nil {
+		return err
+	}
+	_, err := eb.data.WriteTo(w)
+	return err
+}
+
+// ConvertToGraphicField converts an image.Image picture to a ZPL compatible Graphic Field.
+// The ZPL ^GF (Graphic Field) supports various data formats, this package supports the
+// normal ASCII encoded, as well as a RLE compressed ASCII format. It also supports the
+// Binary Graphic Field format. The encoding can be chosen by the second argument.
+// The dither argument selects how grayscale pixels are reduced to black/white; this
+// matters most for photographic source images, where a flat 50% threshold produces
+// ugly solid blobs.
+//
+// ConvertToGraphicField is a thin wrapper over Encoder for callers that just want a
+// string; converting many labels should use an Encoder directly to reuse its buffers.
+func ConvertToGraphicField(source image.Image, graphicType GraphicType, dither Dither) (string, error) {
+	var buf bytes.Buffer
+	enc := Encoder{GraphicType: graphicType, Dither: dither}
+	if err := enc.Encode(&buf, source); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// monoImage reduces img to a 1-bit paletted image (white/black) using the given Dither
+// configuration, suitable for feeding to png.Encode to get a 1-bit-depth PNG.
+func monoImage(img image.Image, dither Dither) *image.Paletted {
+	size := img.Bounds().Size()
+	bits := ditherImage(buildGrayscaleBuffer(img, nil), size.X, size.Y, dither, nil)
+	out := image.NewPaletted(img.Bounds(), color.Palette{color.White, color.Black})
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			if bits[y*size.X+x] {
+				out.SetColorIndex(x, y, 1)
+			} else {
+				out.SetColorIndex(x, y, 0)
+			}
+		}
+	}
+	return out
+}
+
+// ConvertToStoredGraphic converts img to ZPL that downloads it as a PNG and recalls it,
+// an alternative to ConvertToGraphicField's ^GF encoding that is dramatically smaller for
+// photographic content on firmware that supports ~DY/^IM. name identifies the graphic on
+// the printer's memory (it is stored as "<name>.PNG"); it should be unique per image.
+// drive is the single-letter storage device to download to and recall from (e.g. "E" for
+// onboard Flash, "R" for DRAM) - it must be the same device the graphic was originally
+// stored on, since ^IM cannot recall an object from a different drive than ~DY stored it to.
+//
+// source is expected to already be flattened (see FlattenImage); it is reduced to 1-bit
+// black/white with config.Dither before PNG encoding. Only graphicType
+// PNG and PNGStored are accepted. PNGStored skips re-encoding and downloading the image,
+// emitting only the ^IM recall for a graphic a previous PNG call already stored.
+func ConvertToStoredGraphic(source image.Image, name string, drive string, graphicType GraphicType, config Config) (string, error) {
+	name = strings.ToUpper(name)
+	imCmd := fmt.Sprintf("^IM%s:%s.PNG\n", drive, name)
+
+	if graphicType == PNGStored {
+		return imCmd, nil
+	}
+	if graphicType != PNG {
+		return "", fmt.Errorf("zplgfa: ConvertToStoredGraphic: unsupported graphic type %v", graphicType)
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: config.PNGCompression}
+	if err := enc.Encode(&buf, monoImage(source, config.Dither)); err != nil {
+		return "", err
+	}
+
+	dyCmd := fmt.Sprintf("~DY%s:%s,P,P,%d,,%s\n", drive, name, buf.Len(), buf.String())
+	return dyCmd + imCmd, nil
 }
@@ -0,0 +1,464 @@
+package zplgfa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestDitherImageNone(t *testing.T) {
+	// 2x2 checkerboard: black, white, white, black (exact 0/1 values avoid threshold edge cases).
+	buf := []float64{0.0, 1.0, 1.0, 0.0}
+	bits := ditherImage(buf, 2, 2, Dither{}, nil)
+	want := []bool{true, false, false, true}
+	for i := range want {
+		if bits[i] != want[i] {
+			t.Errorf("bits[%d] = %v, want %v", i, bits[i], want[i])
+		}
+	}
+}
+
+func TestDitherImageThreshold(t *testing.T) {
+	buf := []float64{0.2, 0.4, 0.6, 0.8}
+	bits := ditherImage(buf, 4, 1, Dither{Mode: DitherThreshold, Threshold: 0.5}, nil)
+	want := []bool{true, true, false, false}
+	for x, w := range want {
+		if bits[x] != w {
+			t.Errorf("bits[%d] = %v, want %v", x, bits[x], w)
+		}
+	}
+}
+
+func TestDitherImageFloydSteinbergPreservesAverage(t *testing.T) {
+	// A uniform mid-gray field should dither to roughly 50% black pixels: Floyd-Steinberg
+	// error diffusion conserves the average value it's fed, it doesn't discard it.
+	const size = 16
+	buf := make([]float64, size*size)
+	for i := range buf {
+		buf[i] = 0.5
+	}
+
+	bits := ditherImage(buf, size, size, Dither{Mode: DitherFloydSteinberg}, nil)
+
+	black := 0
+	for _, b := range bits {
+		if b {
+			black++
+		}
+	}
+
+	total := size * size
+	if black < total/4 || black > 3*total/4 {
+		t.Errorf("Floyd-Steinberg on uniform 0.5 input produced %d/%d black pixels, want roughly half", black, total)
+	}
+}
+
+func TestDitherImageAtkinsonKnownPixel(t *testing.T) {
+	// A single dark pixel on an otherwise white row: below 0.5 it must come out black.
+	// Only that pixel is checked; the diffused error on its neighbors is not.
+	buf := []float64{0.1, 1.0, 1.0, 1.0, 1.0, 1.0, 1.0, 1.0}
+	bits := ditherImage(buf, 4, 2, Dither{Mode: DitherAtkinson}, nil)
+	if !bits[0] {
+		t.Errorf("bits[0] = false, want true (0.1 is well below the 0.5 cutoff)")
+	}
+}
+
+// referenceGraphicField re-implements the pre-Encoder ^GF algorithm (plain 50% luminance
+// threshold, string concatenation) so the pooled/streaming Encoder can be checked for
+// byte-for-byte parity against known-good output.
+func referenceGraphicField(source image.Image, graphicType GraphicType) string {
+	var gfType string
+	var lastLine string
+	size := source.Bounds().Size()
+	width := size.X / 8
+	height := size.Y
+	if size.Y%8 != 0 {
+		width = width + 1
+	}
+
+	var data string
+	for y := 0; y < size.Y; y++ {
+		line := make([]uint8, width)
+		lineIndex := 0
+		index := uint8(0)
+		currentByte := line[lineIndex]
+		for x := 0; x < size.X; x++ {
+			index = index + 1
+			p := source.At(x, y)
+			lum := color.Gray16Model.Convert(p).(color.Gray16)
+			if lum.Y < 0xffff/2 {
+				currentByte = currentByte | (1 << (8 - index))
+			}
+			if index >= 8 {
+				line[lineIndex] = currentByte
+				lineIndex++
+				if lineIndex < len(line) {
+					currentByte = line[lineIndex]
+				}
+				index = 0
+			}
+		}
+
+		hexstr := strings.ToUpper(hex.EncodeToString(line))
+
+		switch graphicType {
+		case ASCII:
+			data += hexstr + "\n"
+		case CompressedASCII:
+			curLine := CompressASCII(hexstr)
+			if lastLine == curLine {
+				data += ":"
+			} else {
+				data += curLine
+			}
+			lastLine = curLine
+		case Binary:
+			data += fmt.Sprintf("%s", line)
+		}
+	}
+
+	if graphicType == ASCII || graphicType == CompressedASCII {
+		gfType = "A"
+	} else if graphicType == Binary {
+		gfType = "B"
+	}
+
+	return fmt.Sprintf("^GF%s,%d,%d,%d,\n%s", gfType, len(data), width*height, width, data)
+}
+
+func testImageForParity() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 5))
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 10; x++ {
+			if (x+y)%2 == 0 {
+				img.Set(x, y, color.NRGBA{A: 255}) // black
+			} else {
+				img.Set(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: 255}) // white
+			}
+		}
+	}
+	return img
+}
+
+func TestConvertToGraphicFieldMatchesReference(t *testing.T) {
+	img := testImageForParity()
+	for _, graphicType := range []GraphicType{ASCII, Binary, CompressedASCII} {
+		got, err := ConvertToGraphicField(img, graphicType, Dither{})
+		if err != nil {
+			t.Fatalf("ConvertToGraphicField(%v): unexpected error: %v", graphicType, err)
+		}
+		want := referenceGraphicField(img, graphicType)
+		if got != want {
+			t.Errorf("ConvertToGraphicField(%v) = %q, want %q", graphicType, got, want)
+		}
+	}
+}
+
+func TestConvertToGraphicFieldRejectsPNG(t *testing.T) {
+	img := testImageForParity()
+	for _, graphicType := range []GraphicType{PNG, PNGStored} {
+		if _, err := ConvertToGraphicField(img, graphicType, Dither{}); err == nil {
+			t.Errorf("ConvertToGraphicField(%v) returned no error, want one (PNG types belong to ConvertToStoredGraphic)", graphicType)
+		}
+	}
+}
+
+// TestConvertToStoredGraphicDriveMatches guards against the ~DY/^IM drive letter
+// mismatch that previously shipped: ^IM can only recall a graphic from the same
+// drive ~DY stored it to, and no test caught the regression when the two commands
+// drifted apart - it was only found by manual review.
+func TestConvertToStoredGraphicDriveMatches(t *testing.T) {
+	img := testImageForParity()
+
+	stored, err := ConvertToStoredGraphic(img, "logo", "R", PNG, Config{})
+	if err != nil {
+		t.Fatalf("ConvertToStoredGraphic(PNG): unexpected error: %v", err)
+	}
+	if !strings.Contains(stored, "~DYR:LOGO") {
+		t.Errorf("ConvertToStoredGraphic(PNG) = %q, want a ~DYR: command", stored)
+	}
+	if !strings.Contains(stored, "^IMR:LOGO") {
+		t.Errorf("ConvertToStoredGraphic(PNG) = %q, want an ^IMR: command using the same drive as ~DY", stored)
+	}
+
+	recall, err := ConvertToStoredGraphic(img, "logo", "R", PNGStored, Config{})
+	if err != nil {
+		t.Fatalf("ConvertToStoredGraphic(PNGStored): unexpected error: %v", err)
+	}
+	if !strings.Contains(recall, "^IMR:LOGO") {
+		t.Errorf("ConvertToStoredGraphic(PNGStored) = %q, want an ^IMR: command matching the drive the PNG call stored to", recall)
+	}
+}
+
+func TestEncoderEncodeMatchesReference(t *testing.T) {
+	img := testImageForParity()
+	for _, graphicType := range []GraphicType{ASCII, Binary, CompressedASCII} {
+		var buf bytes.Buffer
+		enc := Encoder{GraphicType: graphicType}
+		if err := enc.Encode(&buf, img); err != nil {
+			t.Fatalf("Encode(%v): unexpected error: %v", graphicType, err)
+		}
+		want := referenceGraphicField(img, graphicType)
+		if buf.String() != want {
+			t.Errorf("Encoder.Encode(%v) = %q, want %q", graphicType, buf.String(), want)
+		}
+	}
+}
+
+func TestEncoderReusesBufferAcrossCalls(t *testing.T) {
+	img := testImageForParity()
+	enc := Encoder{GraphicType: ASCII}
+
+	var first bytes.Buffer
+	if err := enc.Encode(&first, img); err != nil {
+		t.Fatalf("first Encode: unexpected error: %v", err)
+	}
+
+	var second bytes.Buffer
+	if err := enc.Encode(&second, img); err != nil {
+		t.Fatalf("second Encode: unexpected error: %v", err)
+	}
+
+	if first.String() != second.String() {
+		t.Errorf("Encoder produced different output on the second call with the default pool:\n%q\n%q", first.String(), second.String())
+	}
+}
+
+func TestDitherImageReusesBitsBuffer(t *testing.T) {
+	buf := []float64{0.0, 1.0, 1.0, 0.0}
+	reuse := make([]bool, 0, 4)
+	bits := ditherImage(buf, 2, 2, Dither{}, reuse)
+	if len(bits) != 4 {
+		t.Fatalf("len(bits) = %d, want 4", len(bits))
+	}
+	if &bits[0] != &reuse[:1][0] {
+		t.Errorf("ditherImage allocated a new slice instead of reusing the one passed in")
+	}
+}
+
+func TestGammaLUTIdentity(t *testing.T) {
+	lut := gammaLUT(1.0)
+	for i := 0; i < 256; i++ {
+		if int(lut[i]) != i {
+			t.Fatalf("gammaLUT(1.0)[%d] = %d, want %d (gamma 1 is the identity curve)", i, lut[i], i)
+		}
+	}
+}
+
+func TestGammaLUTKnownValues(t *testing.T) {
+	// gamma 2.2 brightens midtones: pow(128/255, 1/2.2)*255 ~= 186.
+	lut := gammaLUT(2.2)
+	if got, want := int(lut[128]), 186; got < want-2 || got > want+2 {
+		t.Errorf("gammaLUT(2.2)[128] = %d, want ~%d", got, want)
+	}
+	if lut[0] != 0 {
+		t.Errorf("gammaLUT(2.2)[0] = %d, want 0", lut[0])
+	}
+	if lut[255] != 255 {
+		t.Errorf("gammaLUT(2.2)[255] = %d, want 255", lut[255])
+	}
+}
+
+func TestClamp255(t *testing.T) {
+	cases := []struct {
+		in, want float64
+	}{
+		{-10, 0},
+		{0, 0},
+		{128, 128},
+		{255, 255},
+		{300, 255},
+	}
+	for _, c := range cases {
+		if got := clamp255(c.in); got != c.want {
+			t.Errorf("clamp255(%v) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestAdjustImageBrightness(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.NRGBA{R: 100, G: 100, B: 100, A: 255})
+
+	out := adjustImage(img, Config{Brightness: 0.2})
+
+	want := uint8(100 + 0.2*255)
+	r, _, _, _ := out.At(0, 0).RGBA()
+	if got := uint8(r >> 8); got != want {
+		t.Errorf("brightness-adjusted R = %d, want %d", got, want)
+	}
+}
+
+func TestAdjustImageNoopWhenUnset(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.NRGBA{R: 42, G: 99, B: 7, A: 255})
+
+	out := adjustImage(img, Config{})
+
+	r, g, b, _ := out.At(0, 0).RGBA()
+	if uint8(r>>8) != 42 || uint8(g>>8) != 99 || uint8(b>>8) != 7 {
+		t.Errorf("adjustImage with a zero-value Config changed pixel data, want no-op")
+	}
+}
+
+func TestUnsharpMaskPreservesFlatImage(t *testing.T) {
+	// A uniformly gray image has nothing to sharpen: blurring it changes nothing, so the
+	// unsharp-mask delta should be zero everywhere.
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+		}
+	}
+
+	out := unsharpMask(img, 2.0, 1.5)
+
+	for i, v := range out.Pix {
+		if i%4 == 3 {
+			continue
+		}
+		if v != 128 {
+			t.Errorf("unsharpMask on a flat image changed Pix[%d] to %d, want 128", i, v)
+		}
+	}
+}
+
+func TestDitherImageBayer4x4MatchesMatrix(t *testing.T) {
+	// A uniform 0.5 input isolates the threshold matrix itself: a pixel comes out black
+	// (buf < matrix) exactly where the corresponding bayer4x4 entry is above 0.5.
+	const size = 8
+	buf := make([]float64, size*size)
+	for i := range buf {
+		buf[i] = 0.5
+	}
+
+	bits := ditherImage(buf, size, size, Dither{Mode: DitherBayer4x4}, nil)
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			want := bayer4x4[y%4][x%4] > 0.5
+			if got := bits[y*size+x]; got != want {
+				t.Errorf("bits[%d][%d] = %v, want %v (bayer4x4[%d][%d] = %v)", y, x, got, want, y%4, x%4, bayer4x4[y%4][x%4])
+			}
+		}
+	}
+}
+
+func TestDitherImageBayer8x8MatchesMatrix(t *testing.T) {
+	const size = 8
+	buf := make([]float64, size*size)
+	for i := range buf {
+		buf[i] = 0.5
+	}
+
+	bits := ditherImage(buf, size, size, Dither{Mode: DitherBayer8x8}, nil)
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			want := bayer8x8[y][x] > 0.5
+			if got := bits[y*size+x]; got != want {
+				t.Errorf("bits[%d][%d] = %v, want %v (bayer8x8[%d][%d] = %v)", y, x, got, want, y, x, bayer8x8[y][x])
+			}
+		}
+	}
+}
+
+// minimalTIFFWithOrientation builds the smallest valid little-endian TIFF/EXIF buffer
+// containing a single Orientation (0x0112) IFD entry, which is what readOrientation
+// actually parses (exif.Decode falls back to treating non-JPEG input as raw TIFF).
+func minimalTIFFWithOrientation(orientation uint16) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("II")
+	binary.Write(&buf, binary.LittleEndian, uint16(42))
+	binary.Write(&buf, binary.LittleEndian, uint32(8)) // offset to the first IFD
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // one entry
+	binary.Write(&buf, binary.LittleEndian, uint16(0x0112))
+	binary.Write(&buf, binary.LittleEndian, uint16(3)) // type SHORT
+	binary.Write(&buf, binary.LittleEndian, uint32(1)) // count
+	binary.Write(&buf, binary.LittleEndian, orientation)
+	binary.Write(&buf, binary.LittleEndian, uint16(0)) // pad the 4-byte value field
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // no next IFD
+	return buf.Bytes()
+}
+
+func TestReadOrientationRoundTrip(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		data := minimalTIFFWithOrientation(uint16(orientation))
+		if got := readOrientation(bytes.NewReader(data)); got != orientation {
+			t.Errorf("readOrientation(tag=%d) = %d, want %d", orientation, got, orientation)
+		}
+	}
+}
+
+func TestReadOrientationDefaultsToOneWithoutExif(t *testing.T) {
+	if got := readOrientation(strings.NewReader("not an exif blob")); got != 1 {
+		t.Errorf("readOrientation on non-EXIF input = %d, want 1 (identity orientation)", got)
+	}
+}
+
+// orientationTestImage is a 3x2 NRGBA image with a distinct color in every corner, so a
+// flip/rotate can be detected by checking where each color ends up.
+func orientationTestImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	red := color.NRGBA{R: 255, A: 255}
+	green := color.NRGBA{G: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	img.Set(0, 0, red)
+	img.Set(2, 0, green)
+	img.Set(0, 1, blue)
+	img.Set(2, 1, white)
+	return img
+}
+
+func TestApplyOrientationIdentity(t *testing.T) {
+	img := orientationTestImage()
+	out := applyOrientation(img, 1)
+	if out.Bounds().Size() != img.Bounds().Size() {
+		t.Fatalf("orientation 1 changed image size: got %v, want %v", out.Bounds().Size(), img.Bounds().Size())
+	}
+	if out.At(0, 0) != img.At(0, 0) {
+		t.Errorf("orientation 1 is not a no-op: top-left corner changed")
+	}
+}
+
+func TestApplyOrientationFlips(t *testing.T) {
+	img := orientationTestImage()
+	red := img.At(0, 0)
+
+	cases := []struct {
+		orientation int
+		// corner the original top-left (red) pixel should end up at
+		x, y int
+	}{
+		{2, 2, 0}, // FlipH: top-left -> top-right
+		{3, 2, 1}, // Rotate180: top-left -> bottom-right
+		{4, 0, 1}, // FlipV: top-left -> bottom-left
+	}
+
+	for _, c := range cases {
+		out := applyOrientation(img, c.orientation)
+		if out.Bounds().Size() != img.Bounds().Size() {
+			t.Errorf("orientation %d changed image size: got %v, want %v", c.orientation, out.Bounds().Size(), img.Bounds().Size())
+		}
+		if got := out.At(c.x, c.y); got != red {
+			t.Errorf("orientation %d: pixel (%d,%d) = %v, want the original top-left color %v", c.orientation, c.x, c.y, got, red)
+		}
+	}
+}
+
+func TestApplyOrientationRotationsSwapDimensions(t *testing.T) {
+	img := orientationTestImage()
+	want := image.Pt(img.Bounds().Dy(), img.Bounds().Dx())
+	for _, orientation := range []int{5, 6, 7, 8} {
+		out := applyOrientation(img, orientation)
+		if got := out.Bounds().Size(); got != want {
+			t.Errorf("orientation %d size = %v, want %v (90-degree rotations swap width/height)", orientation, got, want)
+		}
+	}
+}